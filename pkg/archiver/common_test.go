@@ -0,0 +1,34 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package archiver_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// CommonSuite builds a small, fixed filesystem tree shared by the archiver test suites.
+type CommonSuite struct {
+	suite.Suite
+
+	tmpDir string
+}
+
+// SetupTest lays out the fixture tree fresh for every test.
+func (suite *CommonSuite) SetupTest() {
+	suite.tmpDir = suite.T().TempDir()
+
+	for _, dir := range []string{"dev", "etc/certs", "lib", "proc/1", "usr/bin"} {
+		suite.Require().NoError(os.MkdirAll(filepath.Join(suite.tmpDir, dir), 0o755))
+	}
+
+	for _, file := range []string{"dev/random", "etc/certs/ca.crt", "etc/hostname", "lib/dynalib.so", "proc/1/exe", "proc/stat", "usr/bin/cp"} {
+		suite.Require().NoError(os.WriteFile(filepath.Join(suite.tmpDir, file), []byte(file), 0o644))
+	}
+
+	suite.Require().NoError(os.Symlink("/usr/bin/cp", filepath.Join(suite.tmpDir, "usr/bin/mv")))
+}
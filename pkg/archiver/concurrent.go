@@ -0,0 +1,281 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package archiver
+
+import (
+	"container/heap"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// concurrentJob is one unit of work for the WithConcurrency worker pool: evaluate a
+// single already-Lstat'd entry and, if it's a directory to descend into, read and
+// enqueue its children.
+type concurrentJob struct {
+	fullPath string
+	relPath  string
+	depth    int
+	info     os.FileInfo
+}
+
+// jobQueue is an unbounded FIFO queue of concurrentJob shared by the worker pool. It
+// exists because, unlike a fixed-size batch of work, the number of directory jobs
+// isn't known up front: each directory a worker reads can enqueue more.
+type jobQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  []concurrentJob
+	closed bool
+}
+
+func newJobQueue() *jobQueue {
+	q := &jobQueue{}
+	q.cond = sync.NewCond(&q.mu)
+
+	return q
+}
+
+func (q *jobQueue) push(job concurrentJob) {
+	q.mu.Lock()
+	q.items = append(q.items, job)
+	q.mu.Unlock()
+
+	q.cond.Signal()
+}
+
+// pop blocks until a job is available or the queue is closed, in which case it
+// reports false.
+func (q *jobQueue) pop() (concurrentJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+
+	if len(q.items) == 0 {
+		return concurrentJob{}, false
+	}
+
+	job := q.items[0]
+	q.items = q.items[1:]
+
+	return job, true
+}
+
+// close wakes every worker blocked in pop once no more jobs will ever be pushed.
+func (q *jobQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+
+	q.cond.Broadcast()
+}
+
+// walkConcurrent is the WithConcurrency counterpart to walk: a pool of workers drains
+// jobQueue, each evaluating one entry via evalEntry and, for directories, reading and
+// enqueueing its children. Results are collected as they complete and only handed to
+// the caller once the whole subtree has been enumerated, merged into RelPath order
+// through a min-heap so the emitted sequence matches the serial walker's.
+func (w *walkState) walkConcurrent(ctx context.Context, ch chan<- FileInfo, rootPath, rootRelPath string, rootInfo os.FileInfo) {
+	root, err := os.Open(rootPath)
+	if err != nil {
+		w.send(ctx, ch, FileInfo{FullPath: rootPath, RelPath: rootRelPath, Error: err})
+
+		return
+	}
+	defer root.Close() //nolint:errcheck
+
+	q := newJobQueue()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results []FileInfo
+	)
+
+	wg.Add(1)
+	q.push(concurrentJob{fullPath: rootPath, relPath: rootRelPath, depth: 0, info: rootInfo})
+
+	go func() {
+		wg.Wait()
+		q.close()
+	}()
+
+	var workers sync.WaitGroup
+
+	for i := 0; i < w.opts.concurrency; i++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for {
+				job, ok := q.pop()
+				if !ok {
+					return
+				}
+
+				w.processJob(ctx, root, q, &wg, &mu, &results, job)
+			}
+		}()
+	}
+
+	workers.Wait()
+
+	h := make(fileInfoHeap, 0, len(results))
+	for _, fi := range results {
+		segments := strings.Split(fi.RelPath, "/")
+		if fi.RelPath == "." {
+			// The root is an ancestor of every other entry, so it must sort first
+			// rather than be compared lexically against its children's names.
+			segments = nil
+		}
+
+		h = append(h, heapEntry{fi: fi, segments: segments})
+	}
+
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		if !w.send(ctx, ch, heap.Pop(&h).(heapEntry).fi) { //nolint:forcetypeassert
+			return
+		}
+	}
+}
+
+// processJob evaluates a single job and, if it descends into a directory, reads its
+// children and pushes a job for each onto q. It always calls wg.Done() exactly once,
+// balancing the wg.Add(1) done by whoever enqueued job.
+func (w *walkState) processJob(
+	ctx context.Context,
+	root *os.File,
+	q *jobQueue,
+	wg *sync.WaitGroup,
+	mu *sync.Mutex,
+	results *[]FileInfo,
+	job concurrentJob,
+) {
+	defer wg.Done()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	fi, emit, descend := w.evalEntry(job.fullPath, job.relPath, job.depth, job.info)
+
+	if emit {
+		mu.Lock()
+		*results = append(*results, fi)
+		mu.Unlock()
+	}
+
+	if !descend {
+		return
+	}
+
+	dir, err := openDirBeneath(root, job.relPath)
+	if err != nil {
+		mu.Lock()
+		*results = append(*results, FileInfo{FullPath: job.fullPath, RelPath: job.relPath, Error: err})
+		mu.Unlock()
+
+		return
+	}
+	defer dir.Close() //nolint:errcheck
+
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		mu.Lock()
+		*results = append(*results, FileInfo{FullPath: job.fullPath, RelPath: job.relPath, Error: err})
+		mu.Unlock()
+
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		childFull := filepath.Join(job.fullPath, entry.Name())
+
+		childRel := entry.Name()
+		if job.relPath != "." {
+			childRel = job.relPath + "/" + entry.Name()
+		}
+
+		childInfo, err := entry.Info()
+		if err != nil {
+			mu.Lock()
+			*results = append(*results, FileInfo{FullPath: childFull, RelPath: childRel, Error: err})
+			mu.Unlock()
+
+			continue
+		}
+
+		wg.Add(1)
+		q.push(concurrentJob{fullPath: childFull, relPath: childRel, depth: job.depth + 1, info: childInfo})
+	}
+}
+
+// heapEntry pairs a FileInfo with its RelPath pre-split into path components, so the
+// merge heap can compare siblings component-by-component rather than by raw byte
+// value. Byte comparison of RelPath itself would misorder e.g. a directory "etc"
+// against a sibling file "etc.bak": "etc.bak" < "etc/certs" because '.' sorts below
+// '/', even though the serial walker always finishes a directory's whole subtree
+// before moving on to its next sibling.
+type heapEntry struct {
+	fi       FileInfo
+	segments []string
+}
+
+// fileInfoHeap is a container/heap.Interface min-heap of heapEntry, used to merge the
+// worker pool's out-of-order results back into the same deterministic, depth-first,
+// lexically-sorted-siblings order the serial walker produces.
+type fileInfoHeap []heapEntry
+
+func (h fileInfoHeap) Len() int { return len(h) }
+
+func (h fileInfoHeap) Less(i, j int) bool {
+	return comparePathSegments(h[i].segments, h[j].segments) < 0
+}
+
+func (h fileInfoHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *fileInfoHeap) Push(x interface{}) { *h = append(*h, x.(heapEntry)) } //nolint:forcetypeassert
+
+func (h *fileInfoHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+
+	return item
+}
+
+// comparePathSegments orders two slash-split relative paths the way a depth-first
+// walk with lexically sorted siblings would: component by component, with a path
+// that is a strict prefix of the other (i.e. its ancestor directory) sorting first.
+func comparePathSegments(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,336 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/opencontainers/go-digest"
+)
+
+// DigestCache caches the content-addressable digests computed by WithChecksum,
+// keyed by the cleaned absolute path of each entry, so that repeated walks of the
+// same root don't have to re-hash files and directories that haven't changed.
+//
+// A DigestCache is safe for concurrent use and may be shared across Walker calls.
+type DigestCache struct {
+	mu   sync.Mutex
+	tree digestTrie
+}
+
+// NewDigestCache creates an empty DigestCache.
+func NewDigestCache() *DigestCache {
+	return &DigestCache{
+		tree: newDigestTrie(),
+	}
+}
+
+// Checksum computes an aggregate digest over every cached entry whose path matches
+// the given doublestar pattern, by combining their individual digests in sorted
+// path order. It only considers entries already populated by a prior walk; it
+// doesn't touch the filesystem.
+func (c *DigestCache) Checksum(pattern string) (digest.Digest, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var paths []string
+
+	c.tree.walk(func(path string, node digestNode) {
+		if ok, _ := doublestar.Match(pattern, path); ok {
+			paths = append(paths, path)
+		}
+	})
+
+	if len(paths) == 0 {
+		return "", fmt.Errorf("no cached entries match pattern %q", pattern)
+	}
+
+	sort.Strings(paths)
+
+	h := digest.SHA256.Digester().Hash()
+
+	for _, p := range paths {
+		node, _ := c.tree.lookup(p)
+		fmt.Fprintf(h, "%s\x00%s\n", p, node.content)
+	}
+
+	return digest.NewDigest(digest.SHA256, h), nil
+}
+
+// digestNode is the pair of digests cached per path: header covers only the
+// entry's own metadata (mode, uid, gid, name), while content is the file's content
+// digest, or the recursive Merkle digest of a directory's children.
+type digestNode struct {
+	header  digest.Digest
+	content digest.Digest
+
+	// modTimeUnixNano and size let a later walk tell whether a cached regular
+	// file entry is still valid without re-reading its content.
+	modTimeUnixNano int64
+	size            int64
+}
+
+func (c *DigestCache) get(absPath string) (digestNode, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.tree.lookup(absPath)
+}
+
+func (c *DigestCache) put(absPath string, node digestNode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tree.insert(absPath, node)
+}
+
+// digester computes and caches the digests for a single walk.
+type digester struct {
+	cache *DigestCache
+	algo  digest.Algorithm
+}
+
+// computeDigests walks rootPath bottom-up, populating d.cache with a digestNode for
+// every entry in the subtree before the Walker streams it out. Digests are computed
+// for the whole subtree on disk, independent of any include/exclude/skip filtering
+// applied to the walk itself.
+func computeDigests(rootPath string, d *digester) (digestNode, error) {
+	info, err := os.Lstat(rootPath)
+	if err != nil {
+		return digestNode{}, err
+	}
+
+	return computeDigestsRec(rootPath, filepath.Base(rootPath), info, d)
+}
+
+func computeDigestsRec(path, name string, info os.FileInfo, d *digester) (digestNode, error) {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return digestNode{}, err
+		}
+
+		return d.digestSymlink(path, name, info, target), nil
+
+	case info.IsDir():
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return digestNode{}, err
+		}
+
+		children := make([]childDigest, 0, len(entries))
+
+		for _, entry := range entries {
+			childInfo, err := entry.Info()
+			if err != nil {
+				return digestNode{}, err
+			}
+
+			childNode, err := computeDigestsRec(filepath.Join(path, entry.Name()), entry.Name(), childInfo, d)
+			if err != nil {
+				return digestNode{}, err
+			}
+
+			children = append(children, childDigest{name: entry.Name(), node: childNode})
+		}
+
+		return d.digestDir(path, name, info, children), nil
+
+	default:
+		return d.digestFile(path, name, info)
+	}
+}
+
+// headerDigest hashes the stat metadata the Merkle tree is sensitive to: mode,
+// ownership and the entry's own name (not its full path, so that moving an
+// unchanged subtree elsewhere only changes digests along the new path).
+func (d *digester) headerDigest(name string, info os.FileInfo) digest.Digest {
+	var uid, gid uint32
+
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		uid, gid = st.Uid, st.Gid
+	}
+
+	h := d.algo.Digester().Hash()
+	fmt.Fprintf(h, "%o\x00%d\x00%d\x00%s", info.Mode(), uid, gid, name)
+
+	return digest.NewDigest(d.algo, h)
+}
+
+// digestFile returns the cached or freshly computed digestNode for a regular file.
+func (d *digester) digestFile(absPath, name string, info os.FileInfo) (digestNode, error) {
+	header := d.headerDigest(name, info)
+
+	if d.cache != nil {
+		if cached, ok := d.cache.get(absPath); ok &&
+			cached.header == header &&
+			cached.modTimeUnixNano == info.ModTime().UnixNano() &&
+			cached.size == info.Size() {
+			return cached, nil
+		}
+	}
+
+	f, err := os.Open(absPath)
+	if err != nil {
+		return digestNode{}, err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	content, err := d.algo.FromReader(f)
+	if err != nil {
+		return digestNode{}, err
+	}
+
+	node := digestNode{
+		header:          header,
+		content:         content,
+		modTimeUnixNano: info.ModTime().UnixNano(),
+		size:            info.Size(),
+	}
+
+	if d.cache != nil {
+		d.cache.put(absPath, node)
+	}
+
+	return node, nil
+}
+
+// digestSymlink hashes the raw link target.
+func (d *digester) digestSymlink(absPath, name string, info os.FileInfo, target string) digestNode {
+	header := d.headerDigest(name, info)
+
+	h := d.algo.Digester().Hash()
+	fmt.Fprintf(h, "%s", target)
+
+	node := digestNode{
+		header:  header,
+		content: digest.NewDigest(d.algo, h),
+	}
+
+	if d.cache != nil {
+		d.cache.put(absPath, node)
+	}
+
+	return node
+}
+
+// digestDir combines the name and header+content digest of each of a directory's
+// (already-digested) children, sorted by name, into a recursive Merkle digest for
+// the directory's content. The directory's own header is kept separately in the
+// node and is not part of that content digest.
+func (d *digester) digestDir(absPath, name string, info os.FileInfo, children []childDigest) digestNode {
+	header := d.headerDigest(name, info)
+
+	sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+
+	h := d.algo.Digester().Hash()
+
+	for _, c := range children {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\n", c.name, c.node.header, c.node.content)
+	}
+
+	node := digestNode{
+		header:  header,
+		content: digest.NewDigest(d.algo, h),
+	}
+
+	if d.cache != nil {
+		d.cache.put(absPath, node)
+	}
+
+	return node
+}
+
+type childDigest struct {
+	name string
+	node digestNode
+}
+
+// digestTrie is a simple in-memory trie keyed by cleaned absolute path components,
+// used to cache digestNode values across walks without re-walking the filesystem.
+type digestTrie struct {
+	root *trieNode
+}
+
+type trieNode struct {
+	children map[string]*trieNode
+	value    digestNode
+	hasValue bool
+}
+
+func newDigestTrie() digestTrie {
+	return digestTrie{root: &trieNode{children: map[string]*trieNode{}}}
+}
+
+func splitPath(absPath string) []string {
+	trimmed := strings.Trim(absPath, "/")
+	if trimmed == "" {
+		return nil
+	}
+
+	return strings.Split(trimmed, "/")
+}
+
+func (t digestTrie) insert(absPath string, value digestNode) {
+	node := t.root
+
+	for _, seg := range splitPath(absPath) {
+		child, ok := node.children[seg]
+		if !ok {
+			child = &trieNode{children: map[string]*trieNode{}}
+			node.children[seg] = child
+		}
+
+		node = child
+	}
+
+	node.value = value
+	node.hasValue = true
+}
+
+func (t digestTrie) lookup(absPath string) (digestNode, bool) {
+	node := t.root
+
+	for _, seg := range splitPath(absPath) {
+		child, ok := node.children[seg]
+		if !ok {
+			return digestNode{}, false
+		}
+
+		node = child
+	}
+
+	return node.value, node.hasValue
+}
+
+func (t digestTrie) walk(fn func(path string, node digestNode)) {
+	var visit func(path string, node *trieNode)
+
+	visit = func(path string, node *trieNode) {
+		if node.hasValue {
+			fn(path, node.value)
+		}
+
+		for name, child := range node.children {
+			childPath := name
+			if path != "" {
+				childPath = path + "/" + name
+			}
+
+			visit(childPath, child)
+		}
+	}
+
+	visit("", t.root)
+}
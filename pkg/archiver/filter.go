@@ -0,0 +1,168 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package archiver
+
+import (
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// globPattern is a single compiled entry of an include/exclude pattern list, modeled
+// on the filter semantics used by fsutil.FilterOpt (and, in turn, .dockerignore):
+// a leading "!" negates the pattern, a trailing "/" restricts it to directories, and
+// "**" matches any number of path components.
+type globPattern struct {
+	glob    string
+	negate  bool
+	dirOnly bool
+}
+
+func compileGlobPattern(raw string) globPattern {
+	p := raw
+
+	negate := strings.HasPrefix(p, "!")
+	if negate {
+		p = p[1:]
+	}
+
+	dirOnly := strings.HasSuffix(p, "/") && p != "/"
+	if dirOnly {
+		p = strings.TrimSuffix(p, "/")
+	}
+
+	return globPattern{
+		glob:    path.Clean(p),
+		negate:  negate,
+		dirOnly: dirOnly,
+	}
+}
+
+// matches reports whether relPath itself (not its ancestors) matches the pattern.
+func (p globPattern) matches(relPath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	ok, _ := doublestar.Match(p.glob, relPath)
+
+	return ok
+}
+
+// covers reports whether relPath is matched by the pattern, either directly or by
+// virtue of one of its ancestor directories matching (mirroring .dockerignore, where
+// excluding a directory excludes everything beneath it).
+func (p globPattern) covers(relPath string, isDir bool) bool {
+	if p.matches(relPath, isDir) {
+		return true
+	}
+
+	for dir := path.Dir(relPath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if ok, _ := doublestar.Match(p.glob, dir); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// couldMatchDescendant reports whether some path below dirRelPath could still match
+// the pattern, so that the Walker can decide whether the whole subtree is safe to
+// prune. It only returns false when it can prove no descendant could possibly match,
+// matching each path component against the pattern's component at the same position
+// (wildcards included) until the pattern's first `**` component.
+func (p globPattern) couldMatchDescendant(dirRelPath string) bool {
+	if dirRelPath == "." {
+		return true
+	}
+
+	patternSegments := strings.Split(p.glob, "/")
+	dirSegments := strings.Split(dirRelPath, "/")
+
+	for i, dirSegment := range dirSegments {
+		if i >= len(patternSegments) {
+			return false
+		}
+
+		if patternSegments[i] == "**" {
+			return true
+		}
+
+		if ok, _ := doublestar.Match(patternSegments[i], dirSegment); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// includeExcludeFilter implements the include/exclude pattern pair accepted by
+// WithIncludePatterns and WithExcludePatterns.
+type includeExcludeFilter struct {
+	includes []globPattern
+	excludes []globPattern
+}
+
+func (f includeExcludeFilter) empty() bool {
+	return len(f.includes) == 0 && len(f.excludes) == 0
+}
+
+// match decides whether an entry should be emitted: it must match at least one
+// include pattern (if any are set), and must not be excluded by the last matching
+// exclude pattern (later patterns take precedence, so a "!pattern" can re-include
+// something an earlier, broader exclude pattern matched).
+func (f includeExcludeFilter) match(relPath string, isDir bool) bool {
+	if len(f.includes) > 0 {
+		included := false
+
+		for _, p := range f.includes {
+			if p.matches(relPath, isDir) {
+				included = true
+
+				break
+			}
+		}
+
+		if !included && isDir {
+			// A directory that might still contain a matching descendant is kept so
+			// the resulting archive retains a consistent parent directory structure,
+			// even though the directory itself doesn't match any include pattern.
+			included = !f.canPrune(relPath)
+		}
+
+		if !included {
+			return false
+		}
+	}
+
+	excluded := false
+
+	for _, p := range f.excludes {
+		if p.covers(relPath, isDir) {
+			excluded = !p.negate
+		}
+	}
+
+	return !excluded
+}
+
+// canPrune reports whether dirRelPath (and everything beneath it) can safely be
+// skipped without ever descending into it, because no include pattern could match
+// anything in that subtree. Exclude patterns are never used to prune: a "!pattern"
+// deeper in the tree may still need to re-include part of an excluded subtree.
+func (f includeExcludeFilter) canPrune(dirRelPath string) bool {
+	if len(f.includes) == 0 {
+		return false
+	}
+
+	for _, p := range f.includes {
+		if p.couldMatchDescendant(dirRelPath) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,125 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// mimeExtensionOverrides maps well-known Talos artefact extensions to a MIME type,
+// for files net/http.DetectContentType doesn't (or can't reliably) classify.
+var mimeExtensionOverrides = map[string]string{
+	".pem":      "application/x-pem-file",
+	".crt":      "application/x-pem-file",
+	".der":      "application/x-x509-ca-cert",
+	".yaml":     "application/x-yaml",
+	".yml":      "application/x-yaml",
+	".tgz":      "application/gzip",
+	".squashfs": "application/x-squashfs",
+	".sqsh":     "application/x-squashfs",
+}
+
+const (
+	elfMagic        = "\x7fELF"
+	squashfsMagicLE = "hsqs"
+)
+
+// detectMIME sniffs the MIME type of a regular file, preferring the extension
+// overrides and well-known magic numbers Talos cares about (PEM, DER, YAML,
+// gzipped tarballs, squashfs, ELF) over net/http.DetectContentType's generic guess.
+func detectMIME(fullPath string, name string) (string, error) {
+	lowerName := strings.ToLower(name)
+
+	// filepath.Ext only ever returns the suffix after the last dot (".gz" for
+	// "foo.tar.gz"), so a double extension like this one needs its own check.
+	if strings.HasSuffix(lowerName, ".tar.gz") {
+		return "application/gzip", nil
+	}
+
+	if mime, ok := mimeExtensionOverrides[filepath.Ext(lowerName)]; ok {
+		return mime, nil
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	buf := make([]byte, 512)
+
+	n, err := f.Read(buf)
+	if err != nil && n == 0 {
+		if errors.Is(err, io.EOF) {
+			return "application/x-empty", nil
+		}
+
+		return "", err
+	}
+
+	buf = buf[:n]
+
+	switch {
+	case bytes.HasPrefix(buf, []byte(elfMagic)):
+		return "application/x-executable", nil
+	case bytes.HasPrefix(buf, []byte(squashfsMagicLE)):
+		return "application/x-squashfs", nil
+	}
+
+	return http.DetectContentType(buf), nil
+}
+
+// MIMEIndex accumulates the MIME type of every file seen by a Walker call it's
+// attached to via WithMIMEIndex, so that callers can look up "all files of type X"
+// after a single walk without walking the tree again.
+type MIMEIndex struct {
+	mu     sync.Mutex
+	byMIME map[string][]string
+}
+
+// NewMIMEIndex creates an empty MIMEIndex.
+func NewMIMEIndex() *MIMEIndex {
+	return &MIMEIndex{byMIME: map[string][]string{}}
+}
+
+func (idx *MIMEIndex) add(mime, relPath string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.byMIME[mime] = append(idx.byMIME[mime], relPath)
+}
+
+// Paths returns the relative paths of every indexed file with the given MIME type,
+// in the order they were encountered during the walk.
+func (idx *MIMEIndex) Paths(mime string) []string {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	return append([]string(nil), idx.byMIME[mime]...)
+}
+
+// MIMETypes returns the set of distinct MIME types seen during the walk, sorted.
+func (idx *MIMEIndex) MIMETypes() []string {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	types := make([]string, 0, len(idx.byMIME))
+	for mime := range idx.byMIME {
+		types = append(types, mime)
+	}
+
+	sort.Strings(types)
+
+	return types
+}
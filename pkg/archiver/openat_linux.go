@@ -0,0 +1,36 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build linux
+
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// openDirBeneath opens the directory at relPath using openat2(2) with
+// RESOLVE_BENEATH, relative to root's file descriptor. RESOLVE_BENEATH rejects the
+// resolution outright if it would cross root's boundary (via "..", an absolute
+// symlink, or a symlink race), so a WithConcurrency walk can open directories
+// directly by their root-relative path without re-validating each path component
+// or holding a chain of parent descriptors open.
+func openDirBeneath(root *os.File, relPath string) (*os.File, error) {
+	how := unix.OpenHow{
+		Flags:   unix.O_RDONLY | unix.O_DIRECTORY | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH,
+	}
+
+	fd, err := unix.Openat2(int(root.Fd()), relPath, &how)
+	if err != nil {
+		return nil, &os.PathError{Op: "openat2", Path: relPath, Err: err}
+	}
+
+	// os.File.ReadDir/Readdir resolve each entry against the *os.File's own Name(),
+	// not the descriptor, so it must be a real path, not relPath relative to root.
+	return os.NewFile(uintptr(fd), filepath.Join(root.Name(), relPath)), nil
+}
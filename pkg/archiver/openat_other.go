@@ -0,0 +1,19 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !linux
+
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// openDirBeneath is the non-Linux fallback used by a WithConcurrency walk: a plain
+// os.Open joining root's own path with relPath, without openat2(2)'s RESOLVE_BENEATH
+// guarantee against a symlink swapped in mid-walk.
+func openDirBeneath(root *os.File, relPath string) (*os.File, error) {
+	return os.Open(filepath.Join(root.Name(), relPath))
+}
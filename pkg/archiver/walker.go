@@ -0,0 +1,638 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package archiver provides interface around file walker to be used for tar/untar and other stuff.
+package archiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// ErrSymlinkEscapesRoot is set (wrapped) on FileInfo.Error by WithBoundedRoot's
+// ErrorOnEscape policy when a symlink's resolved target falls outside the walk root.
+var ErrSymlinkEscapesRoot = errors.New("archiver: symlink target escapes walk root")
+
+// FileType is the type of the file being reported by the Walker.
+type FileType int
+
+// EscapePolicy controls how WithBoundedRoot handles a symlink whose target resolves
+// outside of the walk root.
+type EscapePolicy int
+
+// EscapePolicy values.
+const (
+	// ErrorOnEscape reports the entry with FileInfo.Error set to ErrSymlinkEscapesRoot,
+	// leaving FileInfo.Link as the symlink's raw, unresolved target.
+	ErrorOnEscape EscapePolicy = iota
+	// SkipEscaping silently omits the entry from the walk.
+	SkipEscaping
+	// RewriteToTarget rewrites FileInfo.Link to the fully resolved, absolute target and
+	// emits the entry without an error.
+	RewriteToTarget
+)
+
+// FileType constants.
+const (
+	// RegularFileType is a regular file.
+	RegularFileType FileType = iota
+	// DirectoryFileType is a directory.
+	DirectoryFileType
+	// SymlinkFileType is a symbolic link.
+	SymlinkFileType
+)
+
+// FileInfo is a single entry produced by the Walker.
+type FileInfo struct {
+	// FullPath is the absolute path to the file on disk.
+	FullPath string
+	// RelPath is the path of the file relative to the root of the walk.
+	RelPath string
+	// FileInfo is the (Lstat) info of the file.
+	FileInfo os.FileInfo
+	// Link is the raw target of the entry, if it's a symlink (or, under
+	// WithBoundedRoot(RewriteToTarget), the resolved target of an escaping one).
+	Link string
+	// Digest is the content-addressable digest of the entry, populated when
+	// WithChecksum is used: the content hash for regular files and symlinks, and
+	// a recursive Merkle digest of its children for directories.
+	Digest digest.Digest
+	// MIMEType is the sniffed MIME type of a regular file, populated when
+	// WithMIMETypes or WithMIMEIndex is used.
+	MIMEType string
+	// Error is set if there was a problem processing this particular entry;
+	// the walk continues past it, other entries are still delivered.
+	Error error
+}
+
+// pseudoFSNames lists the top level directories that are typically backed by
+// pseudo (non-persistent) filesystems on a running Linux system.
+var pseudoFSNames = []string{"dev", "proc", "sys", "run"}
+
+// walkerOptions holds the configuration built up by WalkerOption values.
+type walkerOptions struct {
+	maxRecurseDepth int
+
+	types []FileType
+
+	fnmatchPatterns []string
+	skipDirPatterns []string
+
+	filter includeExcludeFilter
+
+	checksum    bool
+	digestAlgo  digest.Algorithm
+	digestCache *DigestCache
+
+	boundedRoot  bool
+	escapePolicy EscapePolicy
+
+	mimeTypes []string
+	mimeIndex *MIMEIndex
+
+	concurrency int
+
+	skipRoot     bool
+	skipPseudoFS bool
+}
+
+func defaultWalkerOptions() walkerOptions {
+	return walkerOptions{
+		maxRecurseDepth: -1,
+	}
+}
+
+// WalkerOption controls the behavior of the Walker.
+type WalkerOption func(*walkerOptions) error
+
+// WithMaxRecurseDepth limits how many levels below the root the Walker will descend.
+//
+// A negative value (the default) means no limit. As a special case, 0 is treated the
+// same as 1, as a depth of zero would otherwise never emit anything below the root.
+func WithMaxRecurseDepth(depth int) WalkerOption {
+	return func(o *walkerOptions) error {
+		o.maxRecurseDepth = depth
+
+		return nil
+	}
+}
+
+// WithFnmatchPatterns only emits entries whose relative path matches at least one
+// of the given fnmatch (filepath.Match) patterns.
+//
+// Unlike WithSkipDirPatterns, this doesn't prevent the Walker from descending into
+// directories which don't match, as descendants of a non-matching directory might
+// still match.
+func WithFnmatchPatterns(patterns ...string) WalkerOption {
+	return func(o *walkerOptions) error {
+		o.fnmatchPatterns = append(o.fnmatchPatterns, patterns...)
+
+		return nil
+	}
+}
+
+// WithSkipDirPatterns prunes any directory (and its whole subtree) whose relative
+// path matches one of the given fnmatch (filepath.Match) patterns. Entries that
+// aren't directories are not affected by these patterns.
+func WithSkipDirPatterns(patterns ...string) WalkerOption {
+	return func(o *walkerOptions) error {
+		o.skipDirPatterns = append(o.skipDirPatterns, patterns...)
+
+		return nil
+	}
+}
+
+// WithIncludePatterns only emits entries matching at least one of the given
+// .dockerignore-style patterns (see WithExcludePatterns for the pattern syntax).
+//
+// Unlike WithFnmatchPatterns, the Walker matches a directory's path components
+// against the patterns' leading components (up to the first "**") to prune whole
+// subtrees that no pattern could possibly match, so e.g.
+// an include of "etc/**/*.crt" never descends into "dev/" or "usr/".
+func WithIncludePatterns(patterns ...string) WalkerOption {
+	return func(o *walkerOptions) error {
+		for _, p := range patterns {
+			o.filter.includes = append(o.filter.includes, compileGlobPattern(p))
+		}
+
+		return nil
+	}
+}
+
+// WithExcludePatterns omits entries matching the given .dockerignore-style patterns.
+// Excluded directories are still descended into, so that a later "!" pattern can
+// re-include entries beneath them.
+//
+// Each pattern is matched against the cleaned, slash-separated relative path of the
+// entry. A pattern matching a directory also matches everything beneath it. A "**"
+// path component matches any number of path components, and a trailing "/" restricts
+// the pattern to directories. A pattern prefixed with "!" re-includes anything matched
+// by a previous pattern; as with .dockerignore, patterns are evaluated in order and the
+// last pattern to match an entry wins.
+func WithExcludePatterns(patterns ...string) WalkerOption {
+	return func(o *walkerOptions) error {
+		for _, p := range patterns {
+			o.filter.excludes = append(o.filter.excludes, compileGlobPattern(p))
+		}
+
+		return nil
+	}
+}
+
+// WithChecksum enables content-addressable digest computation, populating
+// FileInfo.Digest for every entry: the content hash for regular files and
+// symlinks, and a recursive Merkle digest (mirroring BuildKit's contenthash) for
+// directories, so a directory's digest depends only on the tree beneath it.
+//
+// algo defaults to SHA-256 when not given. Computing digests requires an extra,
+// up-front pass over the whole subtree rooted at rootPath, independent of any
+// filtering options also passed to Walker.
+func WithChecksum(algo ...digest.Algorithm) WalkerOption {
+	return func(o *walkerOptions) error {
+		o.checksum = true
+
+		if len(algo) > 0 {
+			o.digestAlgo = algo[0]
+		}
+
+		return nil
+	}
+}
+
+// WithDigestCache shares a *DigestCache across the walk, so that digests already
+// known from a previous walk of the same root don't need to be recomputed.
+// Implies WithChecksum.
+func WithDigestCache(cache *DigestCache) WalkerOption {
+	return func(o *walkerOptions) error {
+		o.checksum = true
+		o.digestCache = cache
+
+		return nil
+	}
+}
+
+// WithBoundedRoot guards against symlinks that would otherwise let the walk escape
+// the original root (e.g. a malicious symlink inside an untrusted mount pointing at
+// /etc/shadow). Every symlink's target is resolved (following any further symlinks
+// in the target chain) and compared against the walk root; escapePolicy (defaulting
+// to ErrorOnEscape) decides what happens to an entry whose target resolves outside.
+func WithBoundedRoot(escapePolicy ...EscapePolicy) WalkerOption {
+	return func(o *walkerOptions) error {
+		o.boundedRoot = true
+		o.escapePolicy = ErrorOnEscape
+
+		if len(escapePolicy) > 0 {
+			o.escapePolicy = escapePolicy[0]
+		}
+
+		return nil
+	}
+}
+
+// WithMIMETypes only emits regular files whose sniffed MIME type (see FileInfo.MIMEType)
+// is one of the given values. Directories are still descended into, but, like other
+// entries that aren't regular files, are never emitted while this option is set.
+func WithMIMETypes(mimes ...string) WalkerOption {
+	return func(o *walkerOptions) error {
+		o.mimeTypes = append(o.mimeTypes, mimes...)
+
+		return nil
+	}
+}
+
+// WithMIMEIndex records the sniffed MIME type of every regular file seen during the
+// walk into idx, so that callers can later ask e.g. "every ELF binary under this
+// root" via idx.Paths without walking the tree again.
+func WithMIMEIndex(idx *MIMEIndex) WalkerOption {
+	return func(o *walkerOptions) error {
+		o.mimeIndex = idx
+
+		return nil
+	}
+}
+
+// WithSkipRoot skips emitting the entry for the root of the walk itself.
+func WithSkipRoot() WalkerOption {
+	return func(o *walkerOptions) error {
+		o.skipRoot = true
+
+		return nil
+	}
+}
+
+// WithSkipPseudoFS skips the well-known pseudo filesystem directories (dev, proc,
+// sys, run) at the top of the walk root, so that walking a live system doesn't
+// descend into virtual filesystems.
+func WithSkipPseudoFS() WalkerOption {
+	return func(o *walkerOptions) error {
+		o.skipPseudoFS = true
+
+		return nil
+	}
+}
+
+// WithFileTypes only emits entries of the given types.
+func WithFileTypes(types ...FileType) WalkerOption {
+	return func(o *walkerOptions) error {
+		o.types = append(o.types, types...)
+
+		return nil
+	}
+}
+
+// WithConcurrency parallelizes the directory reads and per-entry stat/readlink/MIME work
+// (digests from WithChecksum are still computed in the serial up-front pass) across n
+// worker goroutines instead of walking the tree with a single one, which matters on
+// trees where that work, not CPU, is the bottleneck (e.g. a cold page cache, or many
+// small files on a network filesystem).
+//
+// The entries a concurrent walk emits are the same, in the same deterministic order,
+// as a serial walk would produce: workers merge their output through a min-heap keyed
+// on RelPath before anything is sent on the returned channel. The trade-off for that
+// determinism is that, unlike the serial walker, nothing is streamed out until the
+// whole subtree has been enumerated, so WithConcurrency favors throughput on large
+// trees over latency to the first result.
+//
+// n must be at least 1 (Walker returns an error otherwise); 1 behaves like the
+// default serial walk.
+func WithConcurrency(n int) WalkerOption {
+	return func(o *walkerOptions) error {
+		if n < 1 {
+			return fmt.Errorf("concurrency must be at least 1, got %d", n)
+		}
+
+		o.concurrency = n
+
+		return nil
+	}
+}
+
+// Walker walks the filesystem tree rooted at rootPath, streaming FileInfo entries
+// over the returned channel in a deterministic, depth-first, lexically sorted order.
+//
+// The channel is closed once the walk is complete or the context is canceled.
+func Walker(ctx context.Context, rootPath string, options ...WalkerOption) (<-chan FileInfo, error) {
+	opts := defaultWalkerOptions()
+
+	for _, o := range options {
+		if err := o(&opts); err != nil {
+			return nil, fmt.Errorf("failed to apply walker option: %w", err)
+		}
+	}
+
+	rootPath = filepath.Clean(rootPath)
+
+	rootInfo, err := os.Stat(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &walkState{
+		opts: opts,
+	}
+
+	if opts.boundedRoot {
+		canonicalRoot, err := filepath.EvalSymlinks(rootPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve walk root: %w", err)
+		}
+
+		w.canonicalRoot = canonicalRoot
+	}
+
+	if opts.checksum {
+		algo := opts.digestAlgo
+		if algo == "" {
+			algo = digest.SHA256
+		}
+
+		cache := opts.digestCache
+		if cache == nil {
+			cache = NewDigestCache()
+		}
+
+		w.digester = &digester{cache: cache, algo: algo}
+
+		if _, err := computeDigests(rootPath, w.digester); err != nil {
+			return nil, fmt.Errorf("failed to compute checksums: %w", err)
+		}
+	}
+
+	ch := make(chan FileInfo)
+
+	rootRel := filepath.Base(rootPath)
+	if rootInfo.IsDir() {
+		rootRel = "."
+	}
+
+	go func() {
+		defer close(ch)
+
+		if opts.concurrency > 1 {
+			w.walkConcurrent(ctx, ch, rootPath, rootRel, rootInfo)
+		} else {
+			w.walk(ctx, ch, rootPath, rootRel, 0, rootInfo)
+		}
+	}()
+
+	return ch, nil
+}
+
+// walkState carries the resolved options across the recursive walk.
+type walkState struct {
+	opts walkerOptions
+
+	// digester is non-nil when WithChecksum was used; its cache is fully
+	// populated before streaming begins.
+	digester *digester
+
+	// canonicalRoot is the symlink-resolved walk root, set when WithBoundedRoot is used.
+	canonicalRoot string
+}
+
+// effectiveMaxDepth returns the depth limit to use for emission/recursion decisions,
+// applying the "0 behaves like 1" rule documented on WithMaxRecurseDepth.
+func (w *walkState) effectiveMaxDepth() int {
+	if w.opts.maxRecurseDepth == 0 {
+		return 1
+	}
+
+	return w.opts.maxRecurseDepth
+}
+
+func (w *walkState) send(ctx context.Context, ch chan<- FileInfo, fi FileInfo) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case ch <- fi:
+		return true
+	}
+}
+
+// evalEntry enriches fi with the symlink/digest/MIME data a single entry needs, and
+// decides whether it should be emitted and, if it's a directory, descended into. It's
+// shared by the serial and concurrent walks so both apply exactly the same rules.
+func (w *walkState) evalEntry(fullPath, relPath string, depth int, info os.FileInfo) (fi FileInfo, emit, descend bool) {
+	fi = FileInfo{
+		FullPath: fullPath,
+		RelPath:  relPath,
+		FileInfo: info,
+	}
+
+	skipEscaped := false
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(fullPath)
+		if err != nil {
+			fi.Error = err
+		} else {
+			fi.Link = link
+
+			if w.opts.boundedRoot {
+				skipEscaped = w.checkEscape(&fi, fullPath, link)
+			}
+		}
+	}
+
+	if w.digester != nil {
+		if node, ok := w.digester.cache.get(fullPath); ok {
+			fi.Digest = node.content
+		}
+	}
+
+	if !info.IsDir() && info.Mode()&os.ModeSymlink == 0 && (len(w.opts.mimeTypes) > 0 || w.opts.mimeIndex != nil) {
+		mime, err := detectMIME(fullPath, info.Name())
+		if err != nil {
+			fi.Error = err
+		} else {
+			fi.MIMEType = mime
+
+			if w.opts.mimeIndex != nil {
+				w.opts.mimeIndex.add(mime, relPath)
+			}
+		}
+	}
+
+	skippedDir := info.IsDir() && (w.matchesSkipDir(relPath) || w.opts.filter.canPrune(relPath))
+
+	emit = w.shouldEmit(relPath, info, depth, fi.MIMEType) && !skippedDir && !skipEscaped
+	descend = info.IsDir() && !skippedDir && !(w.opts.maxRecurseDepth >= 0 && depth >= w.effectiveMaxDepth())
+
+	return fi, emit, descend
+}
+
+// walk processes a single entry and, if it's a directory which should be
+// descended into, its children. It returns false if the walk should stop
+// because the context was canceled.
+func (w *walkState) walk(ctx context.Context, ch chan<- FileInfo, fullPath, relPath string, depth int, info os.FileInfo) bool {
+	fi, emit, descend := w.evalEntry(fullPath, relPath, depth, info)
+
+	if emit {
+		if !w.send(ctx, ch, fi) {
+			return false
+		}
+	}
+
+	if !descend {
+		return true
+	}
+
+	entries, err := os.ReadDir(fullPath)
+	if err != nil {
+		return w.send(ctx, ch, FileInfo{FullPath: fullPath, RelPath: relPath, Error: err})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		childFull := filepath.Join(fullPath, entry.Name())
+
+		childRel := entry.Name()
+		if relPath != "." {
+			childRel = relPath + "/" + entry.Name()
+		}
+
+		childInfo, err := entry.Info()
+		if err != nil {
+			if !w.send(ctx, ch, FileInfo{FullPath: childFull, RelPath: childRel, Error: err}) {
+				return false
+			}
+
+			continue
+		}
+
+		if !w.walk(ctx, ch, childFull, childRel, depth+1, childInfo) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (w *walkState) shouldEmit(relPath string, info os.FileInfo, depth int, mimeType string) bool {
+	if relPath == "." && w.opts.skipRoot {
+		return false
+	}
+
+	if w.opts.maxRecurseDepth >= 0 && depth > w.effectiveMaxDepth() {
+		return false
+	}
+
+	if len(w.opts.types) > 0 && !containsFileType(w.opts.types, fileType(info)) {
+		return false
+	}
+
+	if len(w.opts.fnmatchPatterns) > 0 && !matchesAny(w.opts.fnmatchPatterns, relPath) {
+		return false
+	}
+
+	if !w.opts.filter.empty() && !w.opts.filter.match(relPath, info.IsDir()) {
+		return false
+	}
+
+	if len(w.opts.mimeTypes) > 0 {
+		if info.IsDir() || info.Mode()&os.ModeSymlink != 0 || !containsString(w.opts.mimeTypes, mimeType) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkEscape resolves a symlink's target against the walk's canonical root and
+// applies the configured EscapePolicy if it resolves outside of it. It reports
+// whether the entry should be omitted from the walk entirely (SkipEscaping).
+func (w *walkState) checkEscape(fi *FileInfo, fullPath, link string) bool {
+	target := link
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(fullPath), target)
+	}
+
+	resolved, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		// The target doesn't exist (a dangling symlink) or isn't otherwise
+		// resolvable on disk; fall back to a purely lexical resolution so that
+		// `..` components are still caught.
+		resolved = filepath.Clean(target)
+	}
+
+	if resolved == w.canonicalRoot || strings.HasPrefix(resolved, w.canonicalRoot+string(filepath.Separator)) {
+		return false
+	}
+
+	switch w.opts.escapePolicy {
+	case SkipEscaping:
+		return true
+	case RewriteToTarget:
+		fi.Link = resolved
+	default: // ErrorOnEscape
+		fi.Error = fmt.Errorf("%w: %s -> %s", ErrSymlinkEscapesRoot, fullPath, resolved)
+	}
+
+	return false
+}
+
+func (w *walkState) matchesSkipDir(relPath string) bool {
+	if matchesAny(w.opts.skipDirPatterns, relPath) {
+		return true
+	}
+
+	if w.opts.skipPseudoFS {
+		for _, name := range pseudoFSNames {
+			if relPath == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func matchesAny(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, relPath); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, want := range values {
+		if want == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsFileType(types []FileType, t FileType) bool {
+	for _, want := range types {
+		if want == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fileType(info os.FileInfo) FileType {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return SymlinkFileType
+	case info.IsDir():
+		return DirectoryFileType
+	default:
+		return RegularFileType
+	}
+}
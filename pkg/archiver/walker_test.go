@@ -229,6 +229,207 @@ func (suite *WalkerSuite) TestIterationSkipPseudoFS() {
 	}, relPaths)
 }
 
+func (suite *WalkerSuite) TestIterationChecksum() {
+	// Mirror etc/certs under a different path, with identical structure and
+	// content, so we can check a directory's digest depends only on the tree
+	// beneath it (name, mode, content), not on where in the tree it lives.
+	mirrorCerts := filepath.Join(suite.tmpDir, "mirror", "certs")
+	suite.Require().NoError(os.MkdirAll(mirrorCerts, 0o755))
+	suite.Require().NoError(os.WriteFile(filepath.Join(mirrorCerts, "ca.crt"), []byte("etc/certs/ca.crt"), 0o644))
+
+	ch, err := archiver.Walker(context.Background(), suite.tmpDir, archiver.WithSkipRoot(), archiver.WithChecksum())
+	suite.Require().NoError(err)
+
+	digests := map[string]string{}
+
+	for fi := range ch {
+		suite.Require().NoError(fi.Error)
+		suite.Assert().NotEmpty(fi.Digest, "missing digest for %s", fi.RelPath)
+		digests[fi.RelPath] = fi.Digest.String()
+	}
+
+	// The digest of a directory only depends on the tree beneath it: an identical
+	// directory at a different path digests the same, while a different one doesn't.
+	suite.Assert().Equal(digests["etc/certs"], digests["mirror/certs"])
+	suite.Assert().NotEqual(digests["etc/certs"], digests["lib"])
+
+	// Adding an unrelated file elsewhere in the tree doesn't change etc/certs's digest.
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.tmpDir, "usr", "bin", "newtool"), []byte("new"), 0o644))
+
+	ch, err = archiver.Walker(context.Background(), suite.tmpDir, archiver.WithSkipRoot(), archiver.WithChecksum())
+	suite.Require().NoError(err)
+
+	for fi := range ch {
+		suite.Require().NoError(fi.Error)
+
+		if fi.RelPath == "etc/certs" {
+			suite.Assert().Equal(digests["etc/certs"], fi.Digest.String())
+		}
+	}
+}
+
+func (suite *WalkerSuite) TestIterationChecksumCache() {
+	cache := archiver.NewDigestCache()
+
+	ch, err := archiver.Walker(context.Background(), suite.tmpDir, archiver.WithSkipRoot(), archiver.WithDigestCache(cache))
+	suite.Require().NoError(err)
+
+	first := map[string]string{}
+	for fi := range ch {
+		suite.Require().NoError(fi.Error)
+		first[fi.RelPath] = fi.Digest.String()
+	}
+
+	ch, err = archiver.Walker(context.Background(), suite.tmpDir, archiver.WithSkipRoot(), archiver.WithDigestCache(cache))
+	suite.Require().NoError(err)
+
+	for fi := range ch {
+		suite.Require().NoError(fi.Error)
+		suite.Assert().Equal(first[fi.RelPath], fi.Digest.String())
+	}
+}
+
+func (suite *WalkerSuite) TestIterationMIMETypes() {
+	ch, err := archiver.Walker(context.Background(), suite.tmpDir, archiver.WithSkipRoot(), archiver.WithMIMETypes("application/x-pem-file"))
+	suite.Require().NoError(err)
+
+	relPaths := []string(nil)
+
+	for fi := range ch {
+		suite.Require().NoError(fi.Error)
+		relPaths = append(relPaths, fi.RelPath)
+		suite.Assert().Equal("application/x-pem-file", fi.MIMEType)
+	}
+
+	suite.Assert().Equal([]string{"etc/certs/ca.crt"}, relPaths)
+}
+
+func (suite *WalkerSuite) TestIterationMIMEIndex() {
+	idx := archiver.NewMIMEIndex()
+
+	ch, err := archiver.Walker(context.Background(), suite.tmpDir, archiver.WithSkipRoot(), archiver.WithMIMEIndex(idx))
+	suite.Require().NoError(err)
+
+	for fi := range ch {
+		suite.Require().NoError(fi.Error)
+	}
+
+	suite.Assert().Equal([]string{"etc/certs/ca.crt"}, idx.Paths("application/x-pem-file"))
+}
+
+func (suite *WalkerSuite) TestIterationMIMETarGz() {
+	// filepath.Ext only ever returns the suffix after the last dot, so a ".tar.gz"
+	// file needs its own check rather than falling into the generic extension table.
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.tmpDir, "archive.tar.gz"), []byte("not really gzip, just named like one"), 0o644))
+
+	ch, err := archiver.Walker(context.Background(), suite.tmpDir, archiver.WithMIMETypes("application/gzip"))
+	suite.Require().NoError(err)
+
+	relPaths := []string(nil)
+
+	for fi := range ch {
+		suite.Require().NoError(fi.Error)
+		relPaths = append(relPaths, fi.RelPath)
+	}
+
+	suite.Assert().Equal([]string{"archive.tar.gz"}, relPaths)
+}
+
+func (suite *WalkerSuite) TestIterationBoundedRootEscape() {
+	outsideDir := suite.T().TempDir()
+	outsideFile := filepath.Join(outsideDir, "secret.txt")
+	suite.Require().NoError(os.WriteFile(outsideFile, []byte("secret"), 0o644))
+
+	escapeLink := filepath.Join(suite.tmpDir, "etc", "escape")
+	suite.Require().NoError(os.Symlink(outsideFile, escapeLink))
+
+	defer func() {
+		suite.Require().NoError(os.Remove(escapeLink))
+	}()
+
+	ch, err := archiver.Walker(context.Background(), suite.tmpDir, archiver.WithSkipRoot(), archiver.WithBoundedRoot())
+	suite.Require().NoError(err)
+
+	var escapeEntry *archiver.FileInfo
+
+	for fi := range ch {
+		fi := fi
+
+		switch fi.RelPath {
+		case "etc/escape":
+			escapeEntry = &fi
+
+			continue
+		case "usr/bin/mv":
+			// CommonSuite's own usr/bin/mv symlink points at the absolute host
+			// path /usr/bin/cp, which also escapes tmpDir under WithBoundedRoot;
+			// that's incidental to this test, not what it's checking.
+			continue
+		}
+
+		suite.Require().NoError(fi.Error)
+	}
+
+	suite.Require().NotNil(escapeEntry)
+	suite.Assert().ErrorIs(escapeEntry.Error, archiver.ErrSymlinkEscapesRoot)
+	suite.Assert().Equal(outsideFile, escapeEntry.Link)
+}
+
+func (suite *WalkerSuite) TestIterationBoundedRootSkipEscaping() {
+	outsideDir := suite.T().TempDir()
+
+	escapeLink := filepath.Join(suite.tmpDir, "etc", "escape")
+	suite.Require().NoError(os.Symlink(outsideDir, escapeLink))
+
+	defer func() {
+		suite.Require().NoError(os.Remove(escapeLink))
+	}()
+
+	ch, err := archiver.Walker(context.Background(), suite.tmpDir, archiver.WithSkipRoot(), archiver.WithBoundedRoot(archiver.SkipEscaping))
+	suite.Require().NoError(err)
+
+	relPaths := []string(nil)
+
+	for fi := range ch {
+		suite.Require().NoError(fi.Error)
+		relPaths = append(relPaths, fi.RelPath)
+	}
+
+	suite.Assert().NotContains(relPaths, "etc/escape")
+}
+
+func (suite *WalkerSuite) TestIterationIncludePatterns() {
+	ch, err := archiver.Walker(context.Background(), suite.tmpDir, archiver.WithSkipRoot(), archiver.WithIncludePatterns("etc/**/*.crt"))
+	suite.Require().NoError(err)
+
+	relPaths := []string(nil)
+
+	for fi := range ch {
+		suite.Require().NoError(fi.Error)
+		relPaths = append(relPaths, fi.RelPath)
+	}
+
+	suite.Assert().Equal([]string{"etc", "etc/certs", "etc/certs/ca.crt"}, relPaths)
+}
+
+func (suite *WalkerSuite) TestIterationExcludePatternsNegation() {
+	ch, err := archiver.Walker(context.Background(), suite.tmpDir,
+		archiver.WithSkipRoot(),
+		archiver.WithFnmatchPatterns("etc", "etc/*", "etc/*/*"),
+		archiver.WithExcludePatterns("etc/certs", "!etc/certs/ca.crt"),
+	)
+	suite.Require().NoError(err)
+
+	relPaths := []string(nil)
+
+	for fi := range ch {
+		suite.Require().NoError(fi.Error)
+		relPaths = append(relPaths, fi.RelPath)
+	}
+
+	suite.Assert().Equal([]string{"etc", "etc/certs/ca.crt", "etc/hostname"}, relPaths)
+}
+
 func (suite *WalkerSuite) TestIterationSkipDirPatternsNested() {
 	nestedDir := filepath.Join(suite.tmpDir, "var", "run", "test")
 	err := os.MkdirAll(nestedDir, 0o755)
@@ -260,6 +461,74 @@ func (suite *WalkerSuite) TestIterationSkipDirPatternsNested() {
 	}
 }
 
+func (suite *WalkerSuite) TestIterationConcurrency() {
+	// "etc.bak" is a sibling of "etc" whose name is a byte-wise "etc" prefix
+	// extended with a character ('.') that sorts below the path separator ('/').
+	// A merge that compares RelPath as a raw string would interleave it into the
+	// middle of etc's subtree instead of after it; make sure it doesn't.
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.tmpDir, "etc.bak"), []byte("backup"), 0o644))
+
+	serialCh, err := archiver.Walker(context.Background(), suite.tmpDir)
+	suite.Require().NoError(err)
+
+	var serial []string
+
+	for fi := range serialCh {
+		suite.Require().NoError(fi.Error)
+		serial = append(serial, fi.RelPath)
+	}
+
+	suite.Assert().Equal([]string{
+		".", "dev", "dev/random",
+		"etc", "etc/certs", "etc/certs/ca.crt", "etc/hostname",
+		"etc.bak",
+		"lib", "lib/dynalib.so",
+		"proc", "proc/1", "proc/1/exe", "proc/stat",
+		"usr", "usr/bin", "usr/bin/cp", "usr/bin/mv",
+	}, serial)
+
+	concurrentCh, err := archiver.Walker(context.Background(), suite.tmpDir, archiver.WithConcurrency(4))
+	suite.Require().NoError(err)
+
+	var concurrent []string
+
+	for fi := range concurrentCh {
+		suite.Require().NoError(fi.Error)
+		concurrent = append(concurrent, fi.RelPath)
+	}
+
+	suite.Assert().Equal(serial, concurrent)
+}
+
+func (suite *WalkerSuite) TestWalkerWildcard() {
+	ch, err := archiver.WalkerWildcard(context.Background(), suite.tmpDir, "etc/**/*.crt")
+	suite.Require().NoError(err)
+
+	var relPaths []string
+	for fi := range ch {
+		suite.Require().NoError(fi.Error)
+		relPaths = append(relPaths, fi.RelPath)
+	}
+
+	// RelPath is relative to the pattern's static prefix ("etc"), not to tmpDir.
+	suite.Assert().Equal([]string{".", "certs", "certs/ca.crt"}, relPaths)
+}
+
+func (suite *WalkerSuite) TestWalkerWildcardChecksum() {
+	cache := archiver.NewDigestCache()
+
+	ch, err := archiver.WalkerWildcard(context.Background(), suite.tmpDir, "etc/**/*.crt", archiver.WithDigestCache(cache))
+	suite.Require().NoError(err)
+
+	for fi := range ch {
+		suite.Require().NoError(fi.Error)
+	}
+
+	checksum, err := archiver.ChecksumWildcard(cache, suite.tmpDir, "etc/**/*.crt")
+	suite.Require().NoError(err)
+	suite.Assert().NotEmpty(checksum.String())
+}
+
 func TestWalkerSuite(t *testing.T) {
 	suite.Run(t, new(WalkerSuite))
 }
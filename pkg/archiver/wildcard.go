@@ -0,0 +1,77 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package archiver
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// WalkerWildcard is Walker for a doublestar pattern rooted at root (e.g.
+// "etc/**/ssl/*.pem") instead of a single directory. It walks the pattern's static
+// (wildcard-free) prefix directly rather than root itself, so e.g. "etc/**/ssl/*.pem"
+// never even opens "usr/", and prunes the remainder of the walk exactly as
+// WithIncludePatterns does. Emitted FileInfo.RelPath is relative to the pattern's
+// static prefix, not to root.
+//
+// Combining it with WithDigestCache populates that cache with the digest of every
+// entry under the static prefix, matching leaves included; ChecksumWildcard then
+// computes a single aggregate digest over the matching ones, mirroring BuildKit's
+// ChecksumWildcard. WithChecksum alone uses a cache private to the walk.
+func WalkerWildcard(ctx context.Context, root, pattern string, options ...WalkerOption) (<-chan FileInfo, error) {
+	prefix, remainder := splitWildcardPrefix(pattern)
+
+	walkRoot := root
+	if prefix != "" {
+		walkRoot = filepath.Join(root, prefix)
+	}
+
+	if remainder != "" {
+		options = append([]WalkerOption{WithIncludePatterns(remainder)}, options...)
+	}
+
+	return Walker(ctx, walkRoot, options...)
+}
+
+// ChecksumWildcard computes a single aggregate digest over every entry under root
+// matching pattern (a doublestar pattern relative to root, as passed to
+// WalkerWildcard), combining their individual digests in sorted path order. cache
+// must already have been populated by a prior WalkerWildcard (or Walker) call over
+// root with WithDigestCache(cache).
+func ChecksumWildcard(cache *DigestCache, root, pattern string) (digest.Digest, error) {
+	absPattern := strings.TrimPrefix(filepath.Join(filepath.Clean(root), pattern), "/")
+
+	return cache.Checksum(absPattern)
+}
+
+// splitWildcardPrefix splits a doublestar pattern into its longest wildcard-free
+// leading path (prefix) and whatever pattern remains relative to it (remainder). If
+// the pattern has no wildcard segment at all, remainder is empty and prefix is the
+// whole (literal) pattern.
+func splitWildcardPrefix(pattern string) (prefix, remainder string) {
+	segments := strings.Split(path.Clean(pattern), "/")
+
+	var prefixSegments []string
+
+	for i, seg := range segments {
+		if isWildcardSegment(seg) {
+			return strings.Join(prefixSegments, "/"), strings.Join(segments[i:], "/")
+		}
+
+		prefixSegments = append(prefixSegments, seg)
+	}
+
+	return strings.Join(prefixSegments, "/"), ""
+}
+
+// isWildcardSegment reports whether a single "/"-delimited pattern segment contains
+// doublestar wildcard syntax.
+func isWildcardSegment(seg string) bool {
+	return seg == "**" || strings.ContainsAny(seg, "*?[{")
+}